@@ -0,0 +1,81 @@
+// Package auditing defines the storage-agnostic audit log surface used by
+// the HTTP API, the Postgres trigger pipeline and (eventually) any
+// application-level instrumentation that wants to record its own entries
+// through the same Backend.
+package auditing
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+// AuditLog mirrors a row of the audit_logs table. Source distinguishes
+// where an entry came from: "" for rows written by audit_trigger_func, a
+// gRPC full method name (e.g. "/users.Users/UpdateUser") for entries
+// written by UnaryServerInterceptor / StreamServerInterceptor, or the job
+// name ("VACUUM", "ROLLUP", "EXPORT") for MAINTENANCE entries written by
+// Scheduler. REVERT entries carry the Source of the entry they reverted.
+type AuditLog struct {
+	ID            int             `json:"id"`
+	TargetTableID int             `json:"targetTableId"`
+	Username      string          `json:"username"`
+	OldValue      json.RawMessage `json:"oldValue"`
+	NewValue      json.RawMessage `json:"newValue"`
+	Operation     string          `json:"operation"`
+	Source        string          `json:"source"`
+	// RevertOf is set on REVERT entries to the id of the audit log they
+	// reverted, so a revert is itself auditable and re-revertable.
+	RevertOf  *int   `json:"revertOf,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Filter narrows a Search call. Zero values are treated as "don't filter on
+// this field".
+type Filter struct {
+	Query     string
+	Username  string
+	Operation string
+	// Table is the target_table_id an entry's TargetTableID must match,
+	// passed as a string since it comes straight off the query string.
+	Table  string
+	Source string
+	From   string
+	To     string
+	Limit  int
+	Offset int
+}
+
+// Backend is the persistence surface audit entries are written to and read
+// back from. Index, Get and Search cover read/write access to individual
+// entries. Reverting a change is handled separately by Reverter, which
+// needs a db handle and a target-table allow-list that not every Backend
+// implementation has.
+type Backend interface {
+	// Setup provisions whatever schema, triggers, hypertables or policies
+	// the backend needs and is safe to call repeatedly.
+	Setup() error
+	Index(log AuditLog) (int, error)
+	Get(id int) (*AuditLog, error)
+	Search(filter Filter) ([]AuditLog, error)
+}
+
+// Options configures the backend returned by New.
+type Options struct {
+	// Kind selects the backend implementation: "postgres" or "timescale".
+	// Anything else (including "meilisearch", which isn't a storage
+	// backend on its own) falls back to "postgres".
+	Kind              string
+	TargetTables      []string
+	RetentionDays     int
+	CompressAfterDays int
+}
+
+// New builds the Backend selected by opts.Kind.
+func New(db *sql.DB, opts Options) Backend {
+	switch opts.Kind {
+	case "timescale":
+		return NewTimescaleBackend(db, opts.TargetTables, opts.RetentionDays, opts.CompressAfterDays)
+	default:
+		return NewPostgresBackend(db, opts.TargetTables)
+	}
+}
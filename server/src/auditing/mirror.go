@@ -0,0 +1,260 @@
+package auditing
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"database/sql"
+
+	"github.com/meilisearch/meilisearch-go"
+)
+
+// Mirror keeps a Meilisearch index in sync with audit_logs so /api/logs/search
+// can run full-text queries over old_value/new_value, which Backend.Search
+// doesn't support, alongside filters on username, operation and time range.
+type Mirror struct {
+	client *meilisearch.Client
+	index  string
+}
+
+// NewMirror returns a Mirror targeting the given Meilisearch instance and
+// index. The index is created lazily on first write.
+func NewMirror(url, apiKey, index string) *Mirror {
+	client := meilisearch.NewClient(meilisearch.ClientConfig{
+		Host:   url,
+		APIKey: apiKey,
+	})
+	return &Mirror{client: client, index: index}
+}
+
+// Setup configures the index's filterable and sortable attributes.
+// Meilisearch indexes start with none configured, so this must run before
+// Search's username/operation/table/time-range filters will work at all.
+func (m *Mirror) Setup() error {
+	filterable := []string{"username", "operation", "targetTableId", "timestamp", "source"}
+	if _, err := m.client.Index(m.index).UpdateFilterableAttributes(&filterable); err != nil {
+		return fmt.Errorf("error configuring meilisearch filterable attributes: %w", err)
+	}
+
+	sortable := []string{"timestamp"}
+	if _, err := m.client.Index(m.index).UpdateSortableAttributes(&sortable); err != nil {
+		return fmt.Errorf("error configuring meilisearch sortable attributes: %w", err)
+	}
+	return nil
+}
+
+// Index upserts a single entry into the Meilisearch index.
+func (m *Mirror) Index(entry AuditLog) error {
+	_, err := m.client.Index(m.index).AddDocuments([]map[string]interface{}{m.document(entry)}, "id")
+	if err != nil {
+		return fmt.Errorf("error indexing audit log %d in meilisearch: %w", entry.ID, err)
+	}
+	return nil
+}
+
+// Reindex streams every row of audit_logs into the Meilisearch index in
+// batches, via backend so it works the same regardless of which Backend is
+// configured.
+func (m *Mirror) Reindex(backend Backend, batchSize int) (int, error) {
+	total := 0
+	offset := 0
+	for {
+		batch, err := backend.Search(Filter{Limit: batchSize, Offset: offset})
+		if err != nil {
+			return total, fmt.Errorf("error reading audit logs for reindex: %w", err)
+		}
+		if len(batch) == 0 {
+			return total, nil
+		}
+
+		docs := make([]map[string]interface{}, len(batch))
+		for i, entry := range batch {
+			docs[i] = m.document(entry)
+		}
+		if _, err := m.client.Index(m.index).AddDocuments(docs, "id"); err != nil {
+			return total, fmt.Errorf("error reindexing batch at offset %d: %w", offset, err)
+		}
+
+		total += len(batch)
+		offset += len(batch)
+	}
+}
+
+// Search runs a full-text query plus filters against the mirrored index.
+func (m *Mirror) Search(filter Filter) ([]AuditLog, error) {
+	expr, err := m.filterExpression(filter)
+	if err != nil {
+		return nil, err
+	}
+	req := &meilisearch.SearchRequest{
+		Filter: expr,
+	}
+	if filter.Limit > 0 {
+		req.Limit = int64(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		req.Offset = int64(filter.Offset)
+	}
+
+	res, err := m.client.Index(m.index).Search(filter.Query, req)
+	if err != nil {
+		return nil, fmt.Errorf("error searching meilisearch: %w", err)
+	}
+
+	logs := make([]AuditLog, 0, len(res.Hits))
+	for _, hit := range res.Hits {
+		doc, ok := hit.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("error reading meilisearch hit: unexpected type %T", hit)
+		}
+		entry, err := entryFromDocument(doc)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, entry)
+	}
+	return logs, nil
+}
+
+func (m *Mirror) filterExpression(filter Filter) (string, error) {
+	var clauses []string
+	if filter.Username != "" {
+		clauses = append(clauses, fmt.Sprintf("username = %q", filter.Username))
+	}
+	if filter.Operation != "" {
+		clauses = append(clauses, fmt.Sprintf("operation = %q", filter.Operation))
+	}
+	if filter.Source != "" {
+		clauses = append(clauses, fmt.Sprintf("source = %q", filter.Source))
+	}
+	if filter.Table != "" {
+		tableID, err := strconv.Atoi(filter.Table)
+		if err != nil {
+			return "", fmt.Errorf("invalid table filter %q: must be a target_table_id integer", filter.Table)
+		}
+		clauses = append(clauses, fmt.Sprintf("targetTableId = %d", tableID))
+	}
+	if filter.From != "" {
+		clauses = append(clauses, fmt.Sprintf("timestamp >= %q", filter.From))
+	}
+	if filter.To != "" {
+		clauses = append(clauses, fmt.Sprintf("timestamp <= %q", filter.To))
+	}
+
+	expr := ""
+	for i, clause := range clauses {
+		if i > 0 {
+			expr += " AND "
+		}
+		expr += clause
+	}
+	return expr, nil
+}
+
+// document flattens an AuditLog into the shape Meilisearch indexes:
+// old_value/new_value are embedded as searchable JSON text, while
+// username, operation, source, target_table_id and timestamp stay as
+// their own filterable/sortable attributes. revertOf is carried through
+// so a reverted entry can still be identified once mirrored, even though
+// it isn't itself filterable.
+func (m *Mirror) document(entry AuditLog) map[string]interface{} {
+	var revertOf interface{}
+	if entry.RevertOf != nil {
+		revertOf = *entry.RevertOf
+	}
+	return map[string]interface{}{
+		"id":            entry.ID,
+		"targetTableId": entry.TargetTableID,
+		"username":      entry.Username,
+		"operation":     entry.Operation,
+		"source":        entry.Source,
+		"revertOf":      revertOf,
+		"timestamp":     entry.Timestamp,
+		"oldValue":      string(entry.OldValue),
+		"newValue":      string(entry.NewValue),
+	}
+}
+
+func entryFromDocument(doc map[string]interface{}) (AuditLog, error) {
+	entry := AuditLog{
+		Username:  stringField(doc, "username"),
+		Operation: stringField(doc, "operation"),
+		Source:    stringField(doc, "source"),
+		Timestamp: stringField(doc, "timestamp"),
+		OldValue:  []byte(stringField(doc, "oldValue")),
+		NewValue:  []byte(stringField(doc, "newValue")),
+	}
+	if id, ok := doc["id"].(float64); ok {
+		entry.ID = int(id)
+	}
+	if tableID, ok := doc["targetTableId"].(float64); ok {
+		entry.TargetTableID = int(tableID)
+	}
+	if revertOf, ok := doc["revertOf"].(float64); ok {
+		id := int(revertOf)
+		entry.RevertOf = &id
+	}
+	return entry, nil
+}
+
+func stringField(doc map[string]interface{}, key string) string {
+	s, _ := doc[key].(string)
+	return s
+}
+
+// RunPoller feeds entries newly written by audit_trigger_func into mirror as
+// they land in audit_logs, using a polling cursor over id rather than
+// LISTEN/NOTIFY. It runs until ctx is cancelled. onIndexed, if non-nil, is
+// called once per successfully mirrored entry so callers can track an
+// indexed-rows metric; onError is called instead on failure.
+func RunPoller(ctx context.Context, db *sql.DB, mirror *Mirror, interval time.Duration, onIndexed func(), onError func(error)) {
+	entries := make(chan AuditLog, 100)
+	go pollAuditLogs(ctx, db, entries, interval)
+
+	for entry := range entries {
+		if err := mirror.Index(entry); err != nil {
+			if onError != nil {
+				onError(err)
+			}
+		} else if onIndexed != nil {
+			onIndexed()
+		}
+	}
+}
+
+func pollAuditLogs(ctx context.Context, db *sql.DB, entries chan<- AuditLog, interval time.Duration) {
+	defer close(entries)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	cursor := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rows, err := db.Query(`
+				SELECT id, target_table_id, username, old_value, new_value, operation, source, revert_of, timestamp
+				FROM audit_logs
+				WHERE id > $1
+				ORDER BY id
+			`, cursor)
+			if err != nil {
+				continue
+			}
+
+			for rows.Next() {
+				var entry AuditLog
+				if err := rows.Scan(&entry.ID, &entry.TargetTableID, &entry.Username, &entry.OldValue, &entry.NewValue, &entry.Operation, &entry.Source, &entry.RevertOf, &entry.Timestamp); err != nil {
+					continue
+				}
+				entries <- entry
+				cursor = entry.ID
+			}
+			rows.Close()
+		}
+	}
+}
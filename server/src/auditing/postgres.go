@@ -0,0 +1,216 @@
+package auditing
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned by Reverter.Revert when the requested audit log
+// doesn't exist. Get instead returns a nil entry and a nil error.
+var ErrNotFound = errors.New("audit log not found")
+
+// PostgresBackend stores audit entries in a plain audit_logs table fed by
+// per-table triggers.
+type PostgresBackend struct {
+	db           *sql.DB
+	targetTables []string
+}
+
+// NewPostgresBackend returns a Backend backed by a plain Postgres table and
+// row-level triggers on targetTables.
+func NewPostgresBackend(db *sql.DB, targetTables []string) *PostgresBackend {
+	return &PostgresBackend{db: db, targetTables: targetTables}
+}
+
+func (b *PostgresBackend) Setup() error {
+	if err := b.createAuditTable(); err != nil {
+		return err
+	}
+	if err := b.createTriggerFunction(); err != nil {
+		return err
+	}
+	return b.createTriggers(b.targetTables)
+}
+
+func (b *PostgresBackend) createAuditTable() error {
+	_, err := b.db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_logs (
+			id SERIAL PRIMARY KEY,
+			target_table_id INTEGER,
+			username TEXT,
+			old_value JSONB,
+			new_value JSONB,
+			operation TEXT,
+			source TEXT NOT NULL DEFAULT '',
+			revert_of INTEGER REFERENCES audit_logs(id),
+			timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating audit table: %w", err)
+	}
+
+	// Older deployments created audit_logs before these columns existed.
+	_, err = b.db.Exec(`ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT ''`)
+	if err != nil {
+		return fmt.Errorf("error adding source column to audit table: %w", err)
+	}
+	_, err = b.db.Exec(`ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS revert_of INTEGER REFERENCES audit_logs(id)`)
+	if err != nil {
+		return fmt.Errorf("error adding revert_of column to audit table: %w", err)
+	}
+	return nil
+}
+
+func (b *PostgresBackend) createTriggerFunction() error {
+	_, err := b.db.Exec(`
+		CREATE OR REPLACE FUNCTION audit_trigger_func()
+		RETURNS TRIGGER AS $$
+		BEGIN
+			IF (TG_OP = 'UPDATE') THEN
+				INSERT INTO audit_logs (target_table_id, username, old_value, new_value, operation)
+				VALUES (OLD.id, current_user, row_to_json(OLD), row_to_json(NEW), TG_OP);
+			ELSIF (TG_OP = 'DELETE') THEN
+				INSERT INTO audit_logs (target_table_id, username, old_value, operation)
+				VALUES (OLD.id, current_user, row_to_json(OLD), TG_OP);
+			ELSIF (TG_OP = 'INSERT') THEN
+				INSERT INTO audit_logs (target_table_id, username, new_value, operation)
+				VALUES (NEW.id, current_user, row_to_json(NEW), TG_OP);
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating trigger function: %w", err)
+	}
+	return nil
+}
+
+func (b *PostgresBackend) createTriggers(targetTables []string) error {
+	for _, table := range targetTables {
+		_, err := b.db.Exec(fmt.Sprintf(`
+			DROP TRIGGER IF EXISTS audit_trigger ON %s;`, table))
+		if err != nil {
+			return fmt.Errorf("error dropping existing trigger: %w", err)
+		}
+		_, err = b.db.Exec(fmt.Sprintf(`
+			CREATE TRIGGER audit_trigger
+			AFTER INSERT OR UPDATE OR DELETE ON %s
+			FOR EACH ROW EXECUTE FUNCTION audit_trigger_func();
+		`, table))
+		if err != nil {
+			return fmt.Errorf("error creating trigger for table %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func (b *PostgresBackend) Index(entry AuditLog) (int, error) {
+	var id int
+	err := b.db.QueryRow(`
+		INSERT INTO audit_logs (target_table_id, username, old_value, new_value, operation, source, revert_of)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, entry.TargetTableID, entry.Username, nullableJSON(entry.OldValue), nullableJSON(entry.NewValue), entry.Operation, entry.Source, entry.RevertOf).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error indexing audit log: %w", err)
+	}
+	return id, nil
+}
+
+func (b *PostgresBackend) Get(id int) (*AuditLog, error) {
+	var entry AuditLog
+	err := b.db.QueryRow(`
+		SELECT id, target_table_id, username, old_value, new_value, operation, source, revert_of, timestamp
+		FROM audit_logs
+		WHERE id = $1
+	`, id).Scan(&entry.ID, &entry.TargetTableID, &entry.Username, &entry.OldValue, &entry.NewValue, &entry.Operation, &entry.Source, &entry.RevertOf, &entry.Timestamp)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error querying audit log: %w", err)
+	}
+	return &entry, nil
+}
+
+func (b *PostgresBackend) Search(filter Filter) ([]AuditLog, error) {
+	query := `
+		SELECT id, target_table_id, username, old_value, new_value, operation, source, revert_of, timestamp
+		FROM audit_logs
+	`
+
+	var (
+		clauses []string
+		args    []interface{}
+	)
+	addClause := func(column, op string, value interface{}) {
+		args = append(args, value)
+		clauses = append(clauses, fmt.Sprintf("%s %s $%d", column, op, len(args)))
+	}
+	if filter.Username != "" {
+		addClause("username", "=", filter.Username)
+	}
+	if filter.Operation != "" {
+		addClause("operation", "=", filter.Operation)
+	}
+	if filter.Source != "" {
+		addClause("source", "=", filter.Source)
+	}
+	if filter.Table != "" {
+		addClause("target_table_id", "=", filter.Table)
+	}
+	if filter.From != "" {
+		addClause("timestamp", ">=", filter.From)
+	}
+	if filter.To != "" {
+		addClause("timestamp", "<=", filter.To)
+	}
+	if len(clauses) > 0 {
+		query += " WHERE " + joinClauses(clauses)
+	}
+
+	query += " ORDER BY timestamp DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query += fmt.Sprintf(" OFFSET %d", filter.Offset)
+	}
+
+	rows, err := b.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []AuditLog
+	for rows.Next() {
+		var entry AuditLog
+		if err := rows.Scan(&entry.ID, &entry.TargetTableID, &entry.Username, &entry.OldValue, &entry.NewValue, &entry.Operation, &entry.Source, &entry.RevertOf, &entry.Timestamp); err != nil {
+			return nil, fmt.Errorf("error scanning audit log: %w", err)
+		}
+		logs = append(logs, entry)
+	}
+	return logs, nil
+}
+
+func joinClauses(clauses []string) string {
+	out := ""
+	for i, c := range clauses {
+		if i > 0 {
+			out += " AND "
+		}
+		out += c
+	}
+	return out
+}
+
+func nullableJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return raw
+}
@@ -0,0 +1,165 @@
+package auditing
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Reverter replays the old/new value of an audit log entry back onto its
+// target table. It only touches tables on the configured allow-list,
+// generates a properly parameterized upsert from each table's real column
+// list, and records the revert itself as a new audit entry.
+type Reverter struct {
+	db           *sql.DB
+	backend      Backend
+	targetTables map[string]bool
+	columns      map[string][]string
+}
+
+// NewReverter builds a Reverter scoped to targetTables, introspecting each
+// table's columns via information_schema once up front.
+func NewReverter(db *sql.DB, backend Backend, targetTables []string) (*Reverter, error) {
+	r := &Reverter{
+		db:           db,
+		backend:      backend,
+		targetTables: make(map[string]bool, len(targetTables)),
+		columns:      make(map[string][]string, len(targetTables)),
+	}
+	for _, table := range targetTables {
+		r.targetTables[table] = true
+	}
+	for _, table := range targetTables {
+		cols, err := r.loadColumns(table)
+		if err != nil {
+			return nil, err
+		}
+		r.columns[table] = cols
+	}
+	return r, nil
+}
+
+func (r *Reverter) loadColumns(table string) ([]string, error) {
+	rows, err := r.db.Query(`
+		SELECT column_name
+		FROM information_schema.columns
+		WHERE table_name = $1
+		ORDER BY ordinal_position
+	`, table)
+	if err != nil {
+		return nil, fmt.Errorf("error introspecting columns for table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, fmt.Errorf("error scanning column for table %s: %w", table, err)
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// Revert replays audit log id back onto its target table and records the
+// revert itself as a new REVERT audit entry referencing id.
+func (r *Reverter) Revert(id int) error {
+	entry, err := r.backend.Get(id)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return ErrNotFound
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var tableName string
+	err = tx.QueryRow("SELECT table_name FROM target_tables WHERE id = $1", entry.TargetTableID).Scan(&tableName)
+	if err != nil {
+		return fmt.Errorf("error getting table name: %w", err)
+	}
+	if !r.targetTables[tableName] {
+		return fmt.Errorf("table %q is not in the configured target tables", tableName)
+	}
+
+	// Avoid audit_trigger_func firing again while we replay the change.
+	if _, err := tx.Exec("SET LOCAL session_replication_role = replica"); err != nil {
+		return fmt.Errorf("error disabling triggers for revert: %w", err)
+	}
+
+	switch entry.Operation {
+	case "UPDATE", "DELETE", "INSERT", "REVERT":
+		// fall through to the shape-based dispatch below.
+	default:
+		return fmt.Errorf("invalid operation: %s", entry.Operation)
+	}
+
+	// Every entry this backend writes - trigger-origin (UPDATE/DELETE/
+	// INSERT) or a prior REVERT - follows the same old/new value
+	// convention: OldValue is the state before the entry's change,
+	// NewValue the state after. Reverting always means restoring
+	// OldValue, so dispatch on whether OldValue exists rather than on the
+	// operation label. This is what lets a REVERT entry be reverted in
+	// turn without needing to track its original operation separately:
+	// DELETE and "REVERT of an INSERT" both have a present OldValue and
+	// no NewValue to speak of, so go through the same table-restoring
+	// upsert; INSERT and "REVERT of a DELETE" both have no OldValue, so
+	// go through the same id-based delete.
+	if hasValue(entry.OldValue) {
+		setClause := r.upsertSetClause(tableName)
+		_, err = tx.Exec(fmt.Sprintf(`
+			INSERT INTO %s SELECT * FROM json_populate_record(null::%s, $1)
+			ON CONFLICT (id) DO UPDATE SET %s
+		`, tableName, tableName, setClause), entry.OldValue)
+	} else {
+		_, err = tx.Exec(fmt.Sprintf(`
+			DELETE FROM %s WHERE id = (($1::json)->>'id')::int
+		`, tableName), entry.NewValue)
+	}
+	if err != nil {
+		return fmt.Errorf("error reverting change: %w", err)
+	}
+
+	revertOf := id
+	_, err = tx.Exec(`
+		INSERT INTO audit_logs (target_table_id, username, old_value, new_value, operation, source, revert_of)
+		VALUES ($1, $2, $3, $4, 'REVERT', $5, $6)
+	`, entry.TargetTableID, "system", entry.NewValue, entry.OldValue, entry.Source, revertOf)
+	if err != nil {
+		return fmt.Errorf("error recording revert audit entry: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// hasValue reports whether raw carries an actual JSON value, as opposed to
+// being unset - which is how a SQL NULL old_value/new_value (as written for
+// INSERT/DELETE-origin entries) scans - or holding the JSON literal "null".
+func hasValue(raw json.RawMessage) bool {
+	trimmed := strings.TrimSpace(string(raw))
+	return trimmed != "" && trimmed != "null"
+}
+
+// upsertSetClause builds "col1 = EXCLUDED.col1, col2 = EXCLUDED.col2, ..."
+// over every column except id, from the cached column list for table.
+func (r *Reverter) upsertSetClause(table string) string {
+	cols := r.columns[table]
+	sets := make([]string, 0, len(cols))
+	for _, col := range cols {
+		if col == "id" {
+			continue
+		}
+		sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", col, col))
+	}
+	return strings.Join(sets, ", ")
+}
@@ -0,0 +1,199 @@
+package auditing
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// JobConfig describes one scheduled maintenance job.
+type JobConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	Schedule      string `mapstructure:"schedule"`
+	RetentionDays int    `mapstructure:"retention_days"`
+	ExportDir     string `mapstructure:"export_dir"`
+}
+
+// Scheduler runs periodic maintenance against audit_logs: VACUUM ANALYZE,
+// an hourly per-table/per-user operation rollup into audit_stats, and a
+// daily export-then-delete of chunks older than a retention window. Every
+// run is recorded as its own MAINTENANCE audit entry via backend.
+type Scheduler struct {
+	cron    *cron.Cron
+	db      *sql.DB
+	backend Backend
+}
+
+// NewScheduler returns an idle Scheduler; call AddVacuumJob/AddRollupJob/
+// AddExportJob to register jobs and Start to run them.
+func NewScheduler(db *sql.DB, backend Backend) *Scheduler {
+	return &Scheduler{cron: cron.New(), db: db, backend: backend}
+}
+
+// AddVacuumJob schedules a VACUUM ANALYZE of audit_logs.
+func (s *Scheduler) AddVacuumJob(cfg JobConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	_, err := s.cron.AddFunc(cfg.Schedule, func() { s.run("VACUUM", s.vacuum) })
+	if err != nil {
+		return fmt.Errorf("error scheduling vacuum job: %w", err)
+	}
+	return nil
+}
+
+// AddRollupJob schedules an hourly INSERT/UPDATE/DELETE count rollup per
+// table/user into audit_stats.
+func (s *Scheduler) AddRollupJob(cfg JobConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	_, err := s.cron.AddFunc(cfg.Schedule, func() { s.run("ROLLUP", s.rollup) })
+	if err != nil {
+		return fmt.Errorf("error scheduling rollup job: %w", err)
+	}
+	return nil
+}
+
+// AddExportJob schedules a daily export of chunks older than
+// cfg.RetentionDays to compressed newline-delimited JSON under
+// cfg.ExportDir, deleting them from Postgres afterwards.
+func (s *Scheduler) AddExportJob(cfg JobConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	_, err := s.cron.AddFunc(cfg.Schedule, func() {
+		s.run("EXPORT", func() error { return s.export(cfg.RetentionDays, cfg.ExportDir) })
+	})
+	if err != nil {
+		return fmt.Errorf("error scheduling export job: %w", err)
+	}
+	return nil
+}
+
+// Start runs all registered jobs on their schedules until Stop is called.
+func (s *Scheduler) Start() { s.cron.Start() }
+
+// Stop waits for any running jobs to finish and stops the scheduler.
+func (s *Scheduler) Stop() { <-s.cron.Stop().Done() }
+
+func (s *Scheduler) run(name string, fn func() error) {
+	start := time.Now()
+	err := fn()
+
+	status := "ok"
+	if err != nil {
+		status = err.Error()
+	}
+	result, _ := json.Marshal(map[string]interface{}{
+		"status":     status,
+		"durationMs": time.Since(start).Milliseconds(),
+	})
+
+	s.backend.Index(AuditLog{
+		Username:  "scheduler",
+		Operation: "MAINTENANCE",
+		Source:    name,
+		NewValue:  result,
+	})
+}
+
+func (s *Scheduler) vacuum() error {
+	_, err := s.db.Exec("VACUUM ANALYZE audit_logs")
+	if err != nil {
+		return fmt.Errorf("error vacuuming audit_logs: %w", err)
+	}
+	return nil
+}
+
+func (s *Scheduler) rollup() error {
+	_, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_stats (
+			target_table_id INTEGER,
+			username TEXT,
+			operation TEXT,
+			hour TIMESTAMP,
+			count INTEGER,
+			PRIMARY KEY (target_table_id, username, operation, hour)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating audit_stats table: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO audit_stats (target_table_id, username, operation, hour, count)
+		SELECT target_table_id, username, operation, date_trunc('hour', timestamp), count(*)
+		FROM audit_logs
+		WHERE timestamp >= now() - interval '1 hour'
+		GROUP BY target_table_id, username, operation, date_trunc('hour', timestamp)
+		ON CONFLICT (target_table_id, username, operation, hour) DO UPDATE SET count = EXCLUDED.count
+	`)
+	if err != nil {
+		return fmt.Errorf("error rolling up audit_logs: %w", err)
+	}
+	return nil
+}
+
+func (s *Scheduler) export(retentionDays int, dir string) error {
+	if retentionDays <= 0 {
+		return nil
+	}
+	threshold := time.Now().AddDate(0, 0, -retentionDays)
+
+	rows, err := s.db.Query(`
+		SELECT id, target_table_id, username, old_value, new_value, operation, source, revert_of, timestamp
+		FROM audit_logs
+		WHERE timestamp < $1
+		ORDER BY id
+	`, threshold)
+	if err != nil {
+		return fmt.Errorf("error querying chunks to export: %w", err)
+	}
+	defer rows.Close()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("error creating export dir: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("audit_logs_%s.ndjson.gz", threshold.Format("20060102")))
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating export file: %w", err)
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	enc := json.NewEncoder(gz)
+
+	exported := 0
+	for rows.Next() {
+		var entry AuditLog
+		if err := rows.Scan(&entry.ID, &entry.TargetTableID, &entry.Username, &entry.OldValue, &entry.NewValue, &entry.Operation, &entry.Source, &entry.RevertOf, &entry.Timestamp); err != nil {
+			gz.Close()
+			return fmt.Errorf("error scanning audit log for export: %w", err)
+		}
+		if err := enc.Encode(entry); err != nil {
+			gz.Close()
+			return fmt.Errorf("error writing exported audit log: %w", err)
+		}
+		exported++
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("error closing export file: %w", err)
+	}
+	if exported == 0 {
+		os.Remove(path)
+		return nil
+	}
+
+	if _, err := s.db.Exec(`DELETE FROM audit_logs WHERE timestamp < $1`, threshold); err != nil {
+		return fmt.Errorf("error deleting exported audit logs: %w", err)
+	}
+	return nil
+}
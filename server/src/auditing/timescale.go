@@ -0,0 +1,125 @@
+package auditing
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// TimescaleBackend stores audit entries in the same audit_logs schema as
+// PostgresBackend, but turns the table into a Timescale hypertable
+// partitioned on timestamp, with a retention policy and native compression
+// on older chunks. Reads, writes and reverts are identical to plain
+// Postgres, so TimescaleBackend only overrides Setup.
+type TimescaleBackend struct {
+	*PostgresBackend
+	db                *sql.DB
+	retentionDays     int
+	compressAfterDays int
+}
+
+// NewTimescaleBackend returns a Backend that provisions audit_logs as a
+// Timescale hypertable. retentionDays is how long chunks are kept before
+// add_retention_policy drops them; compressAfterDays is how old a chunk
+// must be before it's eligible for native compression. A value of 0
+// disables the corresponding policy.
+func NewTimescaleBackend(db *sql.DB, targetTables []string, retentionDays, compressAfterDays int) *TimescaleBackend {
+	return &TimescaleBackend{
+		PostgresBackend:   NewPostgresBackend(db, targetTables),
+		db:                db,
+		retentionDays:     retentionDays,
+		compressAfterDays: compressAfterDays,
+	}
+}
+
+func (b *TimescaleBackend) Setup() error {
+	if _, err := b.db.Exec(`CREATE EXTENSION IF NOT EXISTS timescaledb`); err != nil {
+		return fmt.Errorf("error creating timescaledb extension: %w", err)
+	}
+	if err := b.PostgresBackend.Setup(); err != nil {
+		return err
+	}
+	if err := b.widenPrimaryKey(); err != nil {
+		return err
+	}
+	if err := b.createHypertable(); err != nil {
+		return err
+	}
+	if err := b.enableCompression(); err != nil {
+		return err
+	}
+	return b.addRetentionPolicy()
+}
+
+// widenPrimaryKey replaces audit_logs' plain "id" primary key (as created by
+// PostgresBackend.Setup) with a composite (id, timestamp) one. Timescale
+// requires the partitioning column to be part of every unique index on a
+// hypertable, so create_hypertable fails against the id-only key. The old
+// id-only uniqueness is preserved as a separate UNIQUE constraint so
+// revert_of's REFERENCES audit_logs(id) still resolves.
+func (b *TimescaleBackend) widenPrimaryKey() error {
+	_, err := b.db.Exec(`
+		DO $$
+		BEGIN
+			IF EXISTS (
+				SELECT 1 FROM pg_constraint
+				WHERE conrelid = 'audit_logs'::regclass AND contype = 'p' AND conname = 'audit_logs_pkey'
+			) THEN
+				ALTER TABLE audit_logs DROP CONSTRAINT audit_logs_pkey;
+				ALTER TABLE audit_logs ADD CONSTRAINT audit_logs_id_key UNIQUE (id);
+				ALTER TABLE audit_logs ADD CONSTRAINT audit_logs_id_timestamp_key PRIMARY KEY (id, timestamp);
+			END IF;
+		END $$;
+	`)
+	if err != nil {
+		return fmt.Errorf("error widening audit_logs primary key for hypertable partitioning: %w", err)
+	}
+	return nil
+}
+
+func (b *TimescaleBackend) createHypertable() error {
+	_, err := b.db.Exec(`
+		SELECT create_hypertable('audit_logs', 'timestamp', if_not_exists => TRUE, migrate_data => TRUE)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating hypertable: %w", err)
+	}
+	return nil
+}
+
+func (b *TimescaleBackend) enableCompression() error {
+	if b.compressAfterDays <= 0 {
+		return nil
+	}
+
+	_, err := b.db.Exec(`
+		ALTER TABLE audit_logs SET (
+			timescaledb.compress,
+			timescaledb.compress_segmentby = 'target_table_id'
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error enabling compression: %w", err)
+	}
+
+	_, err = b.db.Exec(fmt.Sprintf(`
+		SELECT add_compression_policy('audit_logs', INTERVAL '%d days', if_not_exists => TRUE)
+	`, b.compressAfterDays))
+	if err != nil {
+		return fmt.Errorf("error adding compression policy: %w", err)
+	}
+	return nil
+}
+
+func (b *TimescaleBackend) addRetentionPolicy() error {
+	if b.retentionDays <= 0 {
+		return nil
+	}
+
+	_, err := b.db.Exec(fmt.Sprintf(`
+		SELECT add_retention_policy('audit_logs', INTERVAL '%d days', if_not_exists => TRUE)
+	`, b.retentionDays))
+	if err != nil {
+		return fmt.Errorf("error adding retention policy: %w", err)
+	}
+	return nil
+}
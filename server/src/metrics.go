@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+var (
+	auditRowsIndexed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "audit_rows_indexed_total",
+		Help: "Audit rows written into the Meilisearch mirror.",
+	})
+	revertsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "audit_reverts_total",
+		Help: "Revert attempts, labeled by outcome.",
+	}, []string{"outcome"})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "audit_api_request_duration_seconds",
+		Help:    "Latency of audit API handlers.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"handler"})
+)
+
+func init() {
+	prometheus.MustRegister(auditRowsIndexed, revertsTotal, requestDuration)
+}
+
+func metricsHandler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+// statusRecorder wraps a ResponseWriter to capture the status code and byte
+// count an Apache-style access log needs.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// accessLogMiddleware logs method, path, status, bytes and duration for
+// every request, and records per-handler latency for /metrics. Handlers are
+// identified by their gorilla/mux route name.
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		duration := time.Since(start)
+
+		handler := "unknown"
+		if route := mux.CurrentRoute(r); route != nil {
+			if name := route.GetName(); name != "" {
+				handler = name
+			}
+		}
+		requestDuration.WithLabelValues(handler).Observe(duration.Seconds())
+
+		logger.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", duration.Milliseconds(),
+		)
+	})
+}
@@ -1,62 +1,114 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
-	"net/http"
-	"os"
-	"strconv"
-	"github.com/rs/cors"
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
+	"github.com/rs/cors"
 	"github.com/spf13/viper"
+	"github.com/yohannes-teshale/bookish_enigma/auditing"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
-	ConnectionString string   `mapstructure:"db_connection_string"`
-	TargetTables     []string `mapstructure:"target_tables"`
-	TargetUsers      []string `mapstructure:"target_users"`
-	Port             int      `mapstructure:"port"`
+	ConnectionString  string   `mapstructure:"db_connection_string"`
+	TargetTables      []string `mapstructure:"target_tables"`
+	TargetUsers       []string `mapstructure:"target_users"`
+	Port              int      `mapstructure:"port"`
+	AuditBackend      string   `mapstructure:"audit_backend"`
+	RetentionDays     int      `mapstructure:"retention_days"`
+	CompressAfterDays int      `mapstructure:"compress_after_days"`
+	MeilisearchURL    string   `mapstructure:"meilisearch_url"`
+	MeilisearchAPIKey string   `mapstructure:"meilisearch_api_key"`
+	MeilisearchIndex  string   `mapstructure:"meilisearch_index"`
+	Jobs              struct {
+		Vacuum auditing.JobConfig `mapstructure:"vacuum"`
+		Rollup auditing.JobConfig `mapstructure:"rollup"`
+		Export auditing.JobConfig `mapstructure:"export"`
+	} `mapstructure:"jobs"`
 }
 
-type AuditLog struct {
-	ID           int             `json:"id"`
-	TargetTableID int             `json:"targetTableId"`
-	Username     string          `json:"username"`
-	OldValue     json.RawMessage `json:"oldValue"`
-	NewValue     json.RawMessage `json:"newValue"`
-	Operation    string          `json:"operation"`
-	Timestamp    string          `json:"timestamp"`
-}
+const mirrorPollInterval = 2 * time.Second
 
 var (
-	db     *sql.DB
-	config Config
+	db       *sql.DB
+	config   Config
+	backend  auditing.Backend
+	mirror   *auditing.Mirror
+	reverter *auditing.Reverter
+	logger   *slog.Logger
 )
 
+// fatalf logs msg and err as structured fields at Error level, then exits
+// the process, mirroring log.Fatalf's behavior for startup failures.
+func fatalf(msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
 func main() {
 	loadConfig()
 	initDB()
 	defer db.Close()
 
 	setupDatabase()
+	startMirror()
+	startScheduler()
 	startServer()
 }
 
+// startScheduler registers and starts the configured maintenance jobs
+// against audit_logs.
+func startScheduler() {
+	scheduler := auditing.NewScheduler(db, backend)
+	if err := scheduler.AddVacuumJob(config.Jobs.Vacuum); err != nil {
+		fatalf("Error setting up vacuum job", err)
+	}
+	if err := scheduler.AddRollupJob(config.Jobs.Rollup); err != nil {
+		fatalf("Error setting up rollup job", err)
+	}
+	if err := scheduler.AddExportJob(config.Jobs.Export); err != nil {
+		fatalf("Error setting up export job", err)
+	}
+	scheduler.Start()
+}
+
+// startMirror wires up the Meilisearch mirror and its background poller, if
+// one is configured.
+func startMirror() {
+	if config.MeilisearchURL == "" {
+		return
+	}
+
+	mirror = auditing.NewMirror(config.MeilisearchURL, config.MeilisearchAPIKey, config.MeilisearchIndex)
+	if err := mirror.Setup(); err != nil {
+		fatalf("Error setting up meilisearch mirror", err)
+	}
+	go auditing.RunPoller(context.Background(), db, mirror, mirrorPollInterval,
+		func() { auditRowsIndexed.Inc() },
+		func(err error) { logger.Error("Error mirroring audit log into meilisearch", "error", err) },
+	)
+}
+
 func loadConfig() {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
 	err := viper.ReadInConfig()
 	if err != nil {
-		log.Fatalf("Error reading config file: %s", err)
+		fatalf("Error reading config file", err)
 	}
 
 	err = viper.Unmarshal(&config)
 	if err != nil {
-		log.Fatalf("Unable to decode config into struct: %s", err)
+		fatalf("Unable to decode config into struct", err)
 	}
 }
 
@@ -64,167 +116,130 @@ func initDB() {
 	var err error
 	db, err = sql.Open("postgres", config.ConnectionString)
 	if err != nil {
-		log.Fatalf("Error opening database connection: %s", err)
+		fatalf("Error opening database connection", err)
 	}
 
 	err = db.Ping()
 	if err != nil {
-		log.Fatalf("Error connecting to the database: %s", err)
+		fatalf("Error connecting to the database", err)
 	}
 }
 
+// setupDatabase provisions whatever schema, triggers and retention/
+// compression policies the configured audit backend needs.
 func setupDatabase() {
-	createAuditTable()
-	createTriggerFunction()
-	createTriggers(config.TargetTables)
-}
-
-func createAuditTable() {
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS audit_logs (
-			id SERIAL PRIMARY KEY,
-			target_table_id INTEGER,
-			username TEXT,
-			old_value JSONB,
-			new_value JSONB,
-			operation TEXT,
-			timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	if err != nil {
-		log.Fatalf("Error creating audit table: %s", err)
+	backend = auditing.New(db, auditing.Options{
+		Kind:              config.AuditBackend,
+		TargetTables:      config.TargetTables,
+		RetentionDays:     config.RetentionDays,
+		CompressAfterDays: config.CompressAfterDays,
+	})
+
+	if err := backend.Setup(); err != nil {
+		fatalf("Error setting up audit backend", err)
 	}
-}
 
-func createTriggerFunction() {
-	_, err := db.Exec(`
-		CREATE OR REPLACE FUNCTION audit_trigger_func()
-		RETURNS TRIGGER AS $$
-		BEGIN
-			IF (TG_OP = 'UPDATE') THEN
-				INSERT INTO audit_logs (target_table_id, username, old_value, new_value, operation)
-				VALUES (OLD.id, current_user, row_to_json(OLD), row_to_json(NEW), TG_OP);
-			ELSIF (TG_OP = 'DELETE') THEN
-				INSERT INTO audit_logs (target_table_id, username, old_value, operation)
-				VALUES (OLD.id, current_user, row_to_json(OLD), TG_OP);
-			ELSIF (TG_OP = 'INSERT') THEN
-				INSERT INTO audit_logs (target_table_id, username, new_value, operation)
-				VALUES (NEW.id, current_user, row_to_json(NEW), TG_OP);
-			END IF;
-			RETURN NULL;
-		END;
-		$$ LANGUAGE plpgsql;
-	`)
+	var err error
+	reverter, err = auditing.NewReverter(db, backend, config.TargetTables)
 	if err != nil {
-		log.Fatalf("Error creating trigger function: %s", err)
-	}
-}
-
-func createTriggers(targetTables []string) {
-	for _, table := range targetTables {
-		_, err := db.Exec(`
-        			DROP TRIGGER IF EXISTS audit_trigger ON users;`)
-    		if err != nil {
-        		log.Fatalf("Error dropping existing trigger: %s", err)
-    		}
-		_, err= db.Exec(fmt.Sprintf(`
-			CREATE TRIGGER audit_trigger
-			AFTER INSERT OR UPDATE OR DELETE ON %s
-			FOR EACH ROW EXECUTE FUNCTION audit_trigger_func();
-		`, table))
-		if err != nil {
-			log.Fatalf("Error creating trigger for table %s: %s", table, err)
-		}
+		fatalf("Error setting up reverter", err)
 	}
 }
 
 func startServer() {
 	r := mux.NewRouter()
-	r.HandleFunc("/api/logs", getAuditLogs).Methods("GET")
-	r.HandleFunc("/api/logs/{id}", getAuditLog).Methods("GET")
-	r.HandleFunc("/api/revert/{id}", revertChange).Methods("POST")
-c := cors.New(cors.Options{
-        AllowedOrigins: []string{"http://localhost:5173"},
-        AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-        AllowedHeaders: []string{"*"},
-    })
-
-    handler := c.Handler(r)
-
-    log.Printf("Starting server on port %d", config.Port)
-    log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", config.Port), handler))
+	r.HandleFunc("/api/logs", getAuditLogs).Methods("GET").Name("getAuditLogs")
+	r.HandleFunc("/api/logs/search", searchAuditLogs).Methods("GET").Name("searchAuditLogs")
+	r.HandleFunc("/api/logs/{id}", getAuditLog).Methods("GET").Name("getAuditLog")
+	r.HandleFunc("/api/revert/{id}", revertChange).Methods("POST").Name("revertChange")
+	r.HandleFunc("/api/admin/reindex", reindexAuditLogs).Methods("POST").Name("reindexAuditLogs")
+	r.Handle("/metrics", metricsHandler()).Methods("GET").Name("metrics")
+	r.Use(accessLogMiddleware)
+
+	c := cors.New(cors.Options{
+		AllowedOrigins: []string{"http://localhost:5173"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"*"},
+	})
+
+	handler := c.Handler(r)
+
 	port := fmt.Sprintf(":%d", config.Port)
-	log.Printf("Starting server on port %s", port)
-	log.Fatal(http.ListenAndServe(port, r))
+	logger.Info("Starting server", "port", port)
+	fatalf("Server exited", http.ListenAndServe(port, handler))
 }
 
 func getAuditLogs(w http.ResponseWriter, r *http.Request) {
-	limit := r.URL.Query().Get("limit")
-	offset := r.URL.Query().Get("offset")
-
-	query := `
-		SELECT id, target_table_id, username, old_value, new_value, operation, timestamp
-		FROM audit_logs
-		ORDER BY timestamp DESC
-	`
-
-	if limit != "" {
-		query += fmt.Sprintf(" LIMIT %s", limit)
-	}
-	if offset != "" {
-		query += fmt.Sprintf(" OFFSET %s", offset)
-	}
-
-	rows, err := db.Query(query)
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+
+	logs, err := backend.Search(auditing.Filter{
+		Source: q.Get("source"),
+		Limit:  limit,
+		Offset: offset,
+	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error querying audit logs: %s", err), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var logs []AuditLog
-	for rows.Next() {
-		var log AuditLog
-		err := rows.Scan(&log.ID, &log.TargetTableID, &log.Username, &log.OldValue, &log.NewValue, &log.Operation, &log.Timestamp)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Error scanning audit log: %s", err), http.StatusInternalServerError)
-			return
-		}
-		logs = append(logs, log)
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(logs)
 }
 
-func getAuditLog(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
+// searchAuditLogs answers GET /api/logs/search?q=...&user=...&op=...&table=...&from=...&to=...
+// with a full-text query over old_value/new_value plus filters, served from
+// the Meilisearch mirror rather than Postgres.
+func searchAuditLogs(w http.ResponseWriter, r *http.Request) {
+	if mirror == nil {
+		http.Error(w, "Search is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+
+	logs, err := mirror.Search(auditing.Filter{
+		Query:     q.Get("q"),
+		Username:  q.Get("user"),
+		Operation: q.Get("op"),
+		Table:     q.Get("table"),
+		From:      q.Get("from"),
+		To:        q.Get("to"),
+		Limit:     limit,
+		Offset:    offset,
+	})
 	if err != nil {
-		http.Error(w, "Invalid audit log ID", http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Error searching audit logs: %s", err), http.StatusInternalServerError)
 		return
 	}
 
-	var log AuditLog
-	err = db.QueryRow(`
-		SELECT id, target_table_id, username, old_value, new_value, operation, timestamp
-		FROM audit_logs
-		WHERE id = $1
-	`, id).Scan(&log.ID, &log.TargetTableID, &log.Username, &log.OldValue, &log.NewValue, &log.Operation, &log.Timestamp)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logs)
+}
 
-	if err == sql.ErrNoRows {
-		http.Error(w, "Audit log not found", http.StatusNotFound)
+// reindexAuditLogs answers POST /api/admin/reindex by streaming the entire
+// audit_logs table into the Meilisearch mirror in batches.
+func reindexAuditLogs(w http.ResponseWriter, r *http.Request) {
+	if mirror == nil {
+		http.Error(w, "Search is not configured", http.StatusServiceUnavailable)
 		return
-	} else if err != nil {
-		http.Error(w, fmt.Sprintf("Error querying audit log: %s", err), http.StatusInternalServerError)
+	}
+
+	count, err := mirror.Reindex(backend, 500)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reindexing audit logs: %s", err), http.StatusInternalServerError)
 		return
 	}
+	auditRowsIndexed.Add(float64(count))
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(log)
+	json.NewEncoder(w).Encode(map[string]int{"reindexed": count})
 }
 
-func revertChange(w http.ResponseWriter, r *http.Request) {
+func getAuditLog(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
@@ -232,74 +247,44 @@ func revertChange(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tx, err := db.Begin()
+	log, err := backend.Get(id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error starting transaction: %s", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error querying audit log: %s", err), http.StatusInternalServerError)
 		return
 	}
-	defer tx.Rollback()
-
-	var targetTableID int
-	var operation string
-	var oldValue, newValue json.RawMessage
-
-	err = tx.QueryRow(`
-		SELECT target_table_id, operation, old_value, new_value
-		FROM audit_logs
-		WHERE id = $1
-	`, id).Scan(&targetTableID, &operation, &oldValue, &newValue)
-
-	if err == sql.ErrNoRows {
+	if log == nil {
 		http.Error(w, "Audit log not found", http.StatusNotFound)
 		return
-	} else if err != nil {
-		http.Error(w, fmt.Sprintf("Error querying audit log: %s", err), http.StatusInternalServerError)
-		return
 	}
 
-	var tableName string
-	err = tx.QueryRow("SELECT table_name FROM target_tables WHERE id = $1", targetTableID).Scan(&tableName)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(log)
+}
+
+func revertChange(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting table name: %s", err), http.StatusInternalServerError)
+		http.Error(w, "Invalid audit log ID", http.StatusBadRequest)
 		return
 	}
 
-	switch operation {
-	case "UPDATE", "DELETE":
-		_, err = tx.Exec(fmt.Sprintf(`
-			INSERT INTO %s SELECT * FROM json_populate_record(null::%s, $1)
-			ON CONFLICT (id) DO UPDATE
-			SET (SELECT string_agg(format('%%I = EXCLUDED.%%I', key, key), ', ')
-				FROM json_object_keys($1::json) AS key)
-		`, tableName, tableName), oldValue)
-	case "INSERT":
-		var id int
-		err = json.Unmarshal(oldValue, &id)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Error parsing old value: %s", err), http.StatusInternalServerError)
-			return
-		}
-		_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = $1", tableName), id)
-	default:
-		http.Error(w, "Invalid operation", http.StatusBadRequest)
+	if err := reverter.Revert(id); err == auditing.ErrNotFound {
+		revertsTotal.WithLabelValues("not_found").Inc()
+		http.Error(w, "Audit log not found", http.StatusNotFound)
 		return
-	}
-
-	if err != nil {
+	} else if err != nil {
+		revertsTotal.WithLabelValues("error").Inc()
 		http.Error(w, fmt.Sprintf("Error reverting change: %s", err), http.StatusInternalServerError)
 		return
 	}
-
-	err = tx.Commit()
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error committing transaction: %s", err), http.StatusInternalServerError)
-		return
-	}
+	revertsTotal.WithLabelValues("success").Inc()
 
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "Change reverted successfully")
 }
 
 func init() {
-	log.SetOutput(os.Stdout)
+	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
 }